@@ -0,0 +1,246 @@
+package hitcounter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(AdminEndpoint{})
+}
+
+// countersRoute is the admin API path this module handles, as a subtree.
+const countersRoute = "/hitcounter/counters/"
+
+// activeHitCounter holds the most recently provisioned HitCounter app, so
+// AdminEndpoint (which Caddy instantiates fresh per request, with no
+// access to app config) can reach the live counters map. There's only
+// ever one "hitcounter" app per Caddy instance.
+var activeHitCounter struct {
+	sync.Mutex
+	hc *HitCounter
+}
+
+func setActiveHitCounter(hc *HitCounter) {
+	activeHitCounter.Lock()
+	activeHitCounter.hc = hc
+	activeHitCounter.Unlock()
+}
+
+func getActiveHitCounter() *HitCounter {
+	activeHitCounter.Lock()
+	defer activeHitCounter.Unlock()
+	return activeHitCounter.hc
+}
+
+// AdminEndpoint is a Caddy admin API module that exposes the hit counter's
+// persisted counts for inspection and management:
+//
+//	GET    /hitcounter/counters            list all keys and values
+//	GET    /hitcounter/counters/{key}      a single value and last-modified time
+//	POST   /hitcounter/counters/{key}/reset reset a counter to initial_seed
+//	DELETE /hitcounter/counters/{key}       remove a counter entirely
+type AdminEndpoint struct{}
+
+// CaddyModule returns the Caddy module information.
+func (AdminEndpoint) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.hitcounter",
+		New: func() caddy.Module { return new(AdminEndpoint) },
+	}
+}
+
+// Routes implements caddy.AdminRouter.
+func (AdminEndpoint) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/hitcounter/counters",
+			Handler: caddy.AdminHandlerFunc(handleCounters),
+		},
+		{
+			Pattern: countersRoute,
+			Handler: caddy.AdminHandlerFunc(handleCounters),
+		},
+	}
+}
+
+func handleCounters(w http.ResponseWriter, r *http.Request) error {
+	hc := getActiveHitCounter()
+	if hc == nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("no hitCounter app is configured"),
+		}
+	}
+
+	if r.URL.Path == "/hitcounter/counters" {
+		return handleListCounters(hc, w, r)
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, countersRoute)
+	if key, ok := strings.CutSuffix(rest, "/reset"); ok {
+		return handleResetCounter(hc, w, r, key)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return handleGetCounter(hc, w, r, rest)
+	case http.MethodDelete:
+		return handleDeleteCounter(hc, w, r, rest)
+	default:
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method %s not allowed", r.Method),
+		}
+	}
+}
+
+func handleListCounters(hc *HitCounter, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method %s not allowed", r.Method),
+		}
+	}
+
+	hc.countersMu.Lock()
+	counters := make(map[string]uint64, len(hc.counters))
+	for k, v := range hc.counters {
+		counters[k] = v
+	}
+	hc.countersMu.Unlock()
+
+	return writeJSON(w, counters)
+}
+
+type counterResponse struct {
+	Key          string     `json:"key"`
+	Value        uint64     `json:"value"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+func handleGetCounter(hc *HitCounter, w http.ResponseWriter, r *http.Request, key string) error {
+	if key == "" {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("missing counter key")}
+	}
+
+	hc.countersMu.Lock()
+	value, ok := hc.counters[key]
+	var lastModified *time.Time
+	if t, ok := hc.updated[key]; ok {
+		lastModified = &t
+	}
+	hc.countersMu.Unlock()
+
+	if !ok {
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: fmt.Errorf("no counter for key %q", key)}
+	}
+
+	return writeJSON(w, counterResponse{Key: key, Value: value, LastModified: lastModified})
+}
+
+func handleResetCounter(hc *HitCounter, w http.ResponseWriter, r *http.Request, key string) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method %s not allowed", r.Method),
+		}
+	}
+	if key == "" {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("missing counter key")}
+	}
+
+	hc.countersMu.Lock()
+	hc.counters[key] = hc.InitialSeed
+	hc.markUpdatedLocked(key)
+	hc.setGaugeLocked(key, hc.counters[key])
+	value := hc.counters[key]
+	hc.countersMu.Unlock()
+
+	// Unlike increment's delta merge, a reset is an explicit single-key
+	// admin action: it forces key's persisted counter to InitialSeed and
+	// drops its bucket history, rather than adding on top of whatever
+	// other nodes have written for it.
+	err := hc.sync([]string{key}, func(stored *persistedState) {
+		if stored.Counters == nil {
+			stored.Counters = make(map[string]uint64)
+		}
+		stored.Counters[key] = value
+		delete(stored.Buckets, key)
+	})
+	if err != nil {
+		hc.recordPersistenceError()
+		return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: err}
+	}
+
+	// Clear the unique-visitor filter too, outside countersMu, so a
+	// previously-seen visitor isn't still suppressed after the reset.
+	if hc.Unique {
+		if err := hc.clearUniqueFilter(key); err != nil {
+			hc.logger.Error("clearing unique-visitor filters", zap.String("key", key), zap.Error(err))
+		}
+	}
+
+	return writeJSON(w, counterResponse{Key: key, Value: value})
+}
+
+func handleDeleteCounter(hc *HitCounter, w http.ResponseWriter, r *http.Request, key string) error {
+	if key == "" {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("missing counter key")}
+	}
+
+	hc.countersMu.Lock()
+	_, existed := hc.counters[key]
+	delete(hc.counters, key)
+	delete(hc.updated, key)
+	delete(hc.buckets, key)
+	delete(hc.syncedCounters, key)
+	delete(hc.syncedBuckets, key)
+	hc.deleteGaugeLocked(key)
+	hc.countersMu.Unlock()
+
+	if !existed {
+		return caddy.APIError{HTTPStatus: http.StatusNotFound, Err: fmt.Errorf("no counter for key %q", key)}
+	}
+
+	// Like reset, deletion forces key's persisted entry away rather than
+	// merging a delta, since it's an explicit single-key admin action.
+	err := hc.sync([]string{key}, func(stored *persistedState) {
+		delete(stored.Counters, key)
+		delete(stored.Buckets, key)
+	})
+	if err != nil {
+		hc.recordPersistenceError()
+		return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: err}
+	}
+
+	// Clear the unique-visitor filter too, outside countersMu, so a
+	// deleted-then-recreated counter doesn't still suppress previously
+	// seen visitors.
+	if hc.Unique {
+		if err := hc.clearUniqueFilter(key); err != nil {
+			hc.logger.Error("clearing unique-visitor filters", zap.String("key", key), zap.Error(err))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Interface guards.
+var (
+	_ caddy.Module      = (*AdminEndpoint)(nil)
+	_ caddy.AdminRouter = (*AdminEndpoint)(nil)
+)
@@ -0,0 +1,231 @@
+package hitcounter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+)
+
+func newTestAdminHitCounter(t *testing.T) *HitCounter {
+	t.Helper()
+	hc := &HitCounter{
+		Style:       "green",
+		InitialSeed: 10,
+		Storage:     &certmagic.FileStorage{Path: t.TempDir()},
+	}
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := hc.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	t.Cleanup(func() { setActiveHitCounter(nil) })
+	return hc
+}
+
+func TestAdminEndpoint_NoActiveHitCounter(t *testing.T) {
+	setActiveHitCounter(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/hitcounter/counters", nil)
+	rec := httptest.NewRecorder()
+	err := handleCounters(rec, req)
+	if err == nil {
+		t.Fatal("expected error when no hitCounter app is configured")
+	}
+	apiErr, ok := err.(caddy.APIError)
+	if !ok {
+		t.Fatalf("expected caddy.APIError, got %T", err)
+	}
+	if apiErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("HTTPStatus = %d, want %d", apiErr.HTTPStatus, http.StatusNotFound)
+	}
+}
+
+func TestAdminEndpoint_ListCounters(t *testing.T) {
+	hc := newTestAdminHitCounter(t)
+	if _, err := hc.hitCounter("a"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+	if _, err := hc.hitCounter("b"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hitcounter/counters", nil)
+	rec := httptest.NewRecorder()
+	if err := handleCounters(rec, req); err != nil {
+		t.Fatalf("handleCounters failed: %v", err)
+	}
+
+	var counters map[string]uint64
+	if err := json.Unmarshal(rec.Body.Bytes(), &counters); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if counters["a"] != 11 || counters["b"] != 11 {
+		t.Errorf("counters = %+v, want a=11, b=11", counters)
+	}
+}
+
+func TestAdminEndpoint_GetCounter(t *testing.T) {
+	hc := newTestAdminHitCounter(t)
+	if _, err := hc.hitCounter("a"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hitcounter/counters/a", nil)
+	rec := httptest.NewRecorder()
+	if err := handleCounters(rec, req); err != nil {
+		t.Fatalf("handleCounters failed: %v", err)
+	}
+
+	var resp counterResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Key != "a" || resp.Value != 11 {
+		t.Errorf("resp = %+v, want key=a value=11", resp)
+	}
+	if resp.LastModified == nil {
+		t.Error("expected LastModified to be set")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hitcounter/counters/missing", nil)
+	rec = httptest.NewRecorder()
+	err := handleCounters(rec, req)
+	if err == nil {
+		t.Fatal("expected error for missing counter")
+	}
+	if apiErr, ok := err.(caddy.APIError); !ok || apiErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("expected 404 APIError, got %#v", err)
+	}
+}
+
+func TestAdminEndpoint_ResetCounter(t *testing.T) {
+	hc := newTestAdminHitCounter(t)
+	if _, err := hc.hitCounter("a"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+	if _, err := hc.hitCounter("a"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/hitcounter/counters/a/reset", nil)
+	rec := httptest.NewRecorder()
+	if err := handleCounters(rec, req); err != nil {
+		t.Fatalf("handleCounters failed: %v", err)
+	}
+
+	var resp counterResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Value != hc.InitialSeed {
+		t.Errorf("reset value = %d, want %d", resp.Value, hc.InitialSeed)
+	}
+	if count := hc.currentCount("a"); count != hc.InitialSeed {
+		t.Errorf("in-memory count after reset = %d, want %d", count, hc.InitialSeed)
+	}
+}
+
+func TestAdminEndpoint_ResetCounterClearsUniqueFilter(t *testing.T) {
+	hc := &HitCounter{
+		Style:   "green",
+		Storage: &certmagic.FileStorage{Path: t.TempDir()},
+		Unique:  true,
+	}
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := hc.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	t.Cleanup(func() { setActiveHitCounter(nil) })
+
+	if _, err := hc.hitCounterUnique("a", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/hitcounter/counters/a/reset", nil)
+	rec := httptest.NewRecorder()
+	if err := handleCounters(rec, req); err != nil {
+		t.Fatalf("handleCounters failed: %v", err)
+	}
+
+	// The same visitor should be able to bump the counter again after the
+	// reset instead of being suppressed by the stale filter.
+	if _, err := hc.hitCounterUnique("a", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+	if count := hc.currentCount("a"); count != 1 {
+		t.Errorf("count after reset + repeat visit = %d, want 1", count)
+	}
+}
+
+func TestAdminEndpoint_DeleteCounterClearsUniqueFilter(t *testing.T) {
+	hc := &HitCounter{
+		Style:   "green",
+		Storage: &certmagic.FileStorage{Path: t.TempDir()},
+		Unique:  true,
+	}
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := hc.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	t.Cleanup(func() { setActiveHitCounter(nil) })
+
+	if _, err := hc.hitCounterUnique("a", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/hitcounter/counters/a", nil)
+	rec := httptest.NewRecorder()
+	if err := handleCounters(rec, req); err != nil {
+		t.Fatalf("handleCounters failed: %v", err)
+	}
+
+	// The same visitor should bump the recreated counter to 1, not be
+	// suppressed by the deleted counter's stale filter.
+	if _, err := hc.hitCounterUnique("a", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+	if count := hc.currentCount("a"); count != 1 {
+		t.Errorf("count after delete + repeat visit = %d, want 1", count)
+	}
+}
+
+func TestAdminEndpoint_DeleteCounter(t *testing.T) {
+	hc := newTestAdminHitCounter(t)
+	if _, err := hc.hitCounter("a"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/hitcounter/counters/a", nil)
+	rec := httptest.NewRecorder()
+	if err := handleCounters(rec, req); err != nil {
+		t.Fatalf("handleCounters failed: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	hc.countersMu.Lock()
+	_, exists := hc.counters["a"]
+	hc.countersMu.Unlock()
+	if exists {
+		t.Error("counter should have been deleted")
+	}
+
+	// Deleting again should 404.
+	req = httptest.NewRequest(http.MethodDelete, "/hitcounter/counters/a", nil)
+	rec = httptest.NewRecorder()
+	err := handleCounters(rec, req)
+	if err == nil {
+		t.Fatal("expected error deleting an already-deleted counter")
+	}
+	if apiErr, ok := err.(caddy.APIError); !ok || apiErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("expected 404 APIError, got %#v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package hitcounter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+func init() {
+	httpcaddyfile.RegisterGlobalOption("hitCounter", parseHitCounter)
+}
+
+// parseHitCounter sets up the "hitCounter" global Caddyfile option:
+//
+//	hitCounter {
+//		style green
+//		pad_digits 6
+//		initial_seed 1000
+//	}
+func parseHitCounter(d *caddyfile.Dispenser, existingVal any) (any, error) {
+	hc, ok := existingVal.(*HitCounter)
+	if !ok {
+		hc = new(HitCounter)
+	}
+	if err := hc.UnmarshalCaddyfile(d); err != nil {
+		return nil, err
+	}
+	return httpcaddyfile.App{
+		Name:  "hitcounter",
+		Value: caddyconfig.JSON(hc, nil),
+	}, nil
+}
+
+// UnmarshalCaddyfile sets up the HitCounter from Caddyfile tokens. Syntax:
+//
+//	hitCounter {
+//		style <name>
+//		pad_digits <n>
+//		initial_seed <n>
+//		key_prefix <prefix>
+//		storage <module> {
+//			...
+//		}
+//		unique on|off
+//		unique_window <duration>
+//		unique_key ip|ip_ua|cookie:<name>
+//		metrics on|off
+//		buckets hourly|daily|both
+//		retention <duration>
+//	}
+func (hc *HitCounter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "style":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				hc.Style = d.Val()
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "pad_digits":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				n, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid pad_digits value %q: %v", d.Val(), err)
+				}
+				hc.PadDigits = n
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "initial_seed":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				seed, err := strconv.ParseUint(d.Val(), 10, 64)
+				if err != nil {
+					return d.Errf("invalid initial seed value %q: %v", d.Val(), err)
+				}
+				hc.InitialSeed = seed
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "key_prefix":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				hc.KeyPrefix = d.Val()
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "storage":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				modName := d.Val()
+				modID := "caddy.storage." + modName
+				unm, err := caddyfile.UnmarshalModule(d, modID)
+				if err != nil {
+					return err
+				}
+				storage, ok := unm.(caddy.StorageConverter)
+				if !ok {
+					return d.Errf("module %s is not a caddy.StorageConverter", modID)
+				}
+				hc.StorageRaw = caddyconfig.JSONModuleObject(storage, "module", modName, nil)
+
+			case "unique":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				switch d.Val() {
+				case "on":
+					hc.Unique = true
+				case "off":
+					hc.Unique = false
+				default:
+					return d.Errf("unique must be 'on' or 'off', got %q", d.Val())
+				}
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "unique_window":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				window, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid unique_window value %q: %v", d.Val(), err)
+				}
+				hc.UniqueWindow = caddy.Duration(window)
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "unique_key":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				val := d.Val()
+				if val != "ip" && val != "ip_ua" && !strings.HasPrefix(val, "cookie:") {
+					return d.Errf("unrecognized unique_key %q", val)
+				}
+				hc.UniqueKey = val
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "metrics":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				switch d.Val() {
+				case "on":
+					hc.Metrics = true
+				case "off":
+					hc.Metrics = false
+				default:
+					return d.Errf("metrics must be 'on' or 'off', got %q", d.Val())
+				}
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "buckets":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				val := d.Val()
+				if val != "hourly" && val != "daily" && val != "both" {
+					return d.Errf("buckets must be 'hourly', 'daily', or 'both', got %q", val)
+				}
+				hc.BucketMode = val
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "retention":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				retention, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid retention value %q: %v", d.Val(), err)
+				}
+				hc.Retention = caddy.Duration(retention)
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			default:
+				return d.Errf("unrecognized hitCounter subdirective '%s'", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// Interface guards.
+var (
+	_ caddyfile.Unmarshaler = (*HitCounter)(nil)
+)
@@ -3,6 +3,7 @@ package hitcounter
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 )
@@ -168,6 +169,229 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 	}
 }
 
+func TestUnmarshalCaddyfile_Unique(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		expectUnique bool
+		expectKey    string
+		expectError  bool
+	}{
+		{
+			name: "unique on with defaults",
+			input: `hitCounter {
+				unique on
+			}`,
+			expectUnique: true,
+		},
+		{
+			name: "unique off",
+			input: `hitCounter {
+				unique off
+			}`,
+			expectUnique: false,
+		},
+		{
+			name: "unique_key ip_ua",
+			input: `hitCounter {
+				unique on
+				unique_key ip_ua
+			}`,
+			expectUnique: true,
+			expectKey:    "ip_ua",
+		},
+		{
+			name: "unique_key cookie",
+			input: `hitCounter {
+				unique on
+				unique_key cookie:session
+			}`,
+			expectUnique: true,
+			expectKey:    "cookie:session",
+		},
+		{
+			name: "invalid unique value",
+			input: `hitCounter {
+				unique maybe
+			}`,
+			expectError: true,
+		},
+		{
+			name: "invalid unique_key",
+			input: `hitCounter {
+				unique_key nonsense
+			}`,
+			expectError: true,
+		},
+		{
+			name: "unique_window duration",
+			input: `hitCounter {
+				unique_window 12h
+			}`,
+		},
+		{
+			name: "invalid unique_window",
+			input: `hitCounter {
+				unique_window notaduration
+			}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := &HitCounter{}
+			d := caddyfile.NewTestDispenser(tt.input)
+			err := hc.UnmarshalCaddyfile(d)
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hc.Unique != tt.expectUnique {
+				t.Errorf("Unique = %v, want %v", hc.Unique, tt.expectUnique)
+			}
+			if tt.expectKey != "" && hc.UniqueKey != tt.expectKey {
+				t.Errorf("UniqueKey = %q, want %q", hc.UniqueKey, tt.expectKey)
+			}
+		})
+	}
+}
+
+func TestUnmarshalCaddyfile_Metrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expect      bool
+		expectError bool
+	}{
+		{
+			name: "metrics on",
+			input: `hitCounter {
+				metrics on
+			}`,
+			expect: true,
+		},
+		{
+			name: "metrics off",
+			input: `hitCounter {
+				metrics off
+			}`,
+			expect: false,
+		},
+		{
+			name: "invalid metrics value",
+			input: `hitCounter {
+				metrics maybe
+			}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := &HitCounter{}
+			d := caddyfile.NewTestDispenser(tt.input)
+			err := hc.UnmarshalCaddyfile(d)
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hc.Metrics != tt.expect {
+				t.Errorf("Metrics = %v, want %v", hc.Metrics, tt.expect)
+			}
+		})
+	}
+}
+
+func TestUnmarshalCaddyfile_BucketsAndRetention(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		expectMode      string
+		expectRetention time.Duration
+		expectError     bool
+	}{
+		{
+			name: "buckets hourly",
+			input: `hitCounter {
+				buckets hourly
+			}`,
+			expectMode: "hourly",
+		},
+		{
+			name: "buckets daily",
+			input: `hitCounter {
+				buckets daily
+			}`,
+			expectMode: "daily",
+		},
+		{
+			name: "buckets both",
+			input: `hitCounter {
+				buckets both
+			}`,
+			expectMode: "both",
+		},
+		{
+			name: "invalid buckets value",
+			input: `hitCounter {
+				buckets weekly
+			}`,
+			expectError: true,
+		},
+		{
+			name: "retention duration",
+			input: `hitCounter {
+				retention 48h
+			}`,
+			expectRetention: 48 * time.Hour,
+		},
+		{
+			name: "invalid retention",
+			input: `hitCounter {
+				retention notaduration
+			}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := &HitCounter{}
+			d := caddyfile.NewTestDispenser(tt.input)
+			err := hc.UnmarshalCaddyfile(d)
+
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectMode != "" && hc.BucketMode != tt.expectMode {
+				t.Errorf("BucketMode = %q, want %q", hc.BucketMode, tt.expectMode)
+			}
+			if tt.expectRetention != 0 && time.Duration(hc.Retention) != tt.expectRetention {
+				t.Errorf("Retention = %v, want %v", time.Duration(hc.Retention), tt.expectRetention)
+			}
+		})
+	}
+}
+
 func TestUnmarshalCaddyfile_EdgeCases(t *testing.T) {
 	t.Run("max uint64 seed", func(t *testing.T) {
 		hc := &HitCounter{}
@@ -213,4 +437,4 @@ func TestUnmarshalCaddyfile_EdgeCases(t *testing.T) {
 			t.Errorf("InitialSeed = %d, want %d", hc.InitialSeed, 0)
 		}
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,144 @@
+package hitcounter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hitCounterMetrics holds the Prometheus collectors for one HitCounter
+// instance. They're only created and registered when Metrics is enabled.
+type hitCounterMetrics struct {
+	total             *prometheus.GaugeVec
+	renderSeconds     prometheus.Histogram
+	persistenceErrors prometheus.Counter
+}
+
+// sharedMetrics is the collector set actually registered with a given
+// prometheus.Registerer, plus how many HitCounter instances are currently
+// relying on it.
+type sharedMetrics struct {
+	refcount          int
+	total             *prometheus.GaugeVec
+	renderSeconds     prometheus.Histogram
+	persistenceErrors prometheus.Counter
+}
+
+// metricsRegistrations tracks sharedMetrics per Registerer, so that when
+// Caddy provisions a new HitCounter (registering the same metric names)
+// before the old one's Cleanup runs, the new instance reuses the old
+// instance's already-registered collectors instead of erroring, and the
+// collectors aren't unregistered until the last instance using them is
+// cleaned up.
+var metricsRegistrations = struct {
+	sync.Mutex
+	byRegisterer map[prometheus.Registerer]*sharedMetrics
+}{byRegisterer: make(map[prometheus.Registerer]*sharedMetrics)}
+
+func newHitCounterMetrics() *hitCounterMetrics {
+	return &hitCounterMetrics{
+		total: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "caddy_hitcounter_total",
+			Help: "Current hit count, per key.",
+		}, []string{"key"}),
+		renderSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "caddy_hitcounter_render_seconds",
+			Help:    "Time spent rendering a hitCounter template function call.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		persistenceErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "caddy_hitcounter_persistence_errors_total",
+			Help: "Total number of errors persisting hit counters to storage.",
+		}),
+	}
+}
+
+// register registers m's collectors with reg, or adopts the collectors
+// already registered for reg if another HitCounter instance registered
+// them first. This is what makes config reloads safe: Caddy provisions the
+// new config (and with it a new HitCounter, calling register again) before
+// stopping and cleaning up the old one, so the metric names are normally
+// already registered by the time this runs.
+func (m *hitCounterMetrics) register(reg prometheus.Registerer) error {
+	metricsRegistrations.Lock()
+	defer metricsRegistrations.Unlock()
+
+	shared, ok := metricsRegistrations.byRegisterer[reg]
+	if !ok {
+		if err := reg.Register(m.total); err != nil {
+			return fmt.Errorf("registering caddy_hitcounter_total: %v", err)
+		}
+		if err := reg.Register(m.renderSeconds); err != nil {
+			return fmt.Errorf("registering caddy_hitcounter_render_seconds: %v", err)
+		}
+		if err := reg.Register(m.persistenceErrors); err != nil {
+			return fmt.Errorf("registering caddy_hitcounter_persistence_errors_total: %v", err)
+		}
+		shared = &sharedMetrics{
+			total:             m.total,
+			renderSeconds:     m.renderSeconds,
+			persistenceErrors: m.persistenceErrors,
+		}
+		metricsRegistrations.byRegisterer[reg] = shared
+	}
+
+	shared.refcount++
+	m.total = shared.total
+	m.renderSeconds = shared.renderSeconds
+	m.persistenceErrors = shared.persistenceErrors
+	return nil
+}
+
+// unregister releases this instance's reference to reg's shared metrics,
+// only actually unregistering the collectors once the last HitCounter
+// instance using them is cleaned up.
+func (m *hitCounterMetrics) unregister(reg prometheus.Registerer) {
+	metricsRegistrations.Lock()
+	defer metricsRegistrations.Unlock()
+
+	shared, ok := metricsRegistrations.byRegisterer[reg]
+	if !ok {
+		return
+	}
+	shared.refcount--
+	if shared.refcount > 0 {
+		return
+	}
+	reg.Unregister(shared.total)
+	reg.Unregister(shared.renderSeconds)
+	reg.Unregister(shared.persistenceErrors)
+	delete(metricsRegistrations.byRegisterer, reg)
+}
+
+// observeRender records how long a render took, if metrics are enabled.
+func (hc *HitCounter) observeRender(start time.Time) {
+	if hc.metrics != nil {
+		hc.metrics.renderSeconds.Observe(time.Since(start).Seconds())
+	}
+}
+
+// setGaugeLocked updates the exported gauge for key, if metrics are
+// enabled. The caller must hold countersMu.
+func (hc *HitCounter) setGaugeLocked(key string, count uint64) {
+	if hc.metrics != nil {
+		hc.metrics.total.WithLabelValues(key).Set(float64(count))
+	}
+}
+
+// deleteGaugeLocked removes the exported gauge for key, if metrics are
+// enabled. The caller must hold countersMu.
+func (hc *HitCounter) deleteGaugeLocked(key string) {
+	if hc.metrics != nil {
+		hc.metrics.total.DeleteLabelValues(key)
+	}
+}
+
+// recordPersistenceError counts a storage-layer failure, if metrics are
+// enabled.
+func (hc *HitCounter) recordPersistenceError() {
+	if hc.metrics != nil {
+		hc.metrics.persistenceErrors.Inc()
+	}
+}
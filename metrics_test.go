@@ -0,0 +1,43 @@
+package hitcounter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHitCounterMetrics_RegisterReload(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	first := newHitCounterMetrics()
+	if err := first.register(reg); err != nil {
+		t.Fatalf("first register failed: %v", err)
+	}
+
+	// Simulate a Caddy config reload: a second instance's metrics are
+	// registered under the same names before the first instance's
+	// Cleanup runs. This must not fail.
+	second := newHitCounterMetrics()
+	if err := second.register(reg); err != nil {
+		t.Fatalf("second register (reload) failed: %v", err)
+	}
+	if second.total != first.total {
+		t.Error("second instance should reuse the first instance's gauge vec")
+	}
+
+	// Tearing down the first (obsolete) instance must not remove the
+	// metrics the second (still-live) instance is relying on.
+	first.unregister(reg)
+	if err := reg.Register(second.total); err == nil {
+		t.Fatal("expected AlreadyRegisteredError: the still-live instance's collector should remain registered")
+	} else if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+		t.Fatalf("expected AlreadyRegisteredError, got %T: %v", err, err)
+	}
+
+	// Once the last instance using these metrics is cleaned up, they're
+	// actually unregistered and the name becomes free again.
+	second.unregister(reg)
+	if err := reg.Register(second.total); err != nil {
+		t.Fatalf("expected re-registration to succeed after the last instance's unregister, got: %v", err)
+	}
+}
@@ -0,0 +1,535 @@
+// Package hitcounter implements a Caddy module that reproduces the classic
+// GeoCities-style image hit counter: every page render bumps a persistent,
+// per-key count and renders it as a row of digit images.
+package hitcounter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(&HitCounter{})
+}
+
+// defaultKeyPrefix namespaces all storage keys this module reads and
+// writes, so a shared storage backend (e.g. redis, consul, s3) can be
+// used by other Caddy apps without key collisions.
+const defaultKeyPrefix = "hitcounter/"
+
+// defaultStyle is used when no digit style is configured.
+const defaultStyle = "classic"
+
+// HitCounter is a Caddy app that renders classic image-based hit counters
+// and keeps a persistent count per key. Configure it as a global Caddyfile
+// option:
+//
+//	hitCounter {
+//		style green
+//		pad_digits 6
+//		initial_seed 1000
+//	}
+//
+// and its `hitCounter` function becomes available to the `templates` HTTP
+// handler, e.g. `{{ hitCounter "home" }}`.
+type HitCounter struct {
+	// Style selects the digit image set to render, e.g. "green" or
+	// "odometer". Defaults to "classic".
+	Style string `json:"style,omitempty"`
+
+	// PadDigits left-pads the rendered count with zeros to at least this
+	// many digits.
+	PadDigits int `json:"pad_digits,omitempty"`
+
+	// InitialSeed is added to a key's counter the first time it is seen,
+	// so hit counts can start from a non-zero number.
+	InitialSeed uint64 `json:"initial_seed,omitempty"`
+
+	// KeyPrefix namespaces the storage keys this module uses. Defaults to
+	// "hitcounter/".
+	KeyPrefix string `json:"key_prefix,omitempty"`
+
+	// StorageRaw is a storage module that, if set, is used instead of
+	// Caddy's default/global storage to persist counters. This allows
+	// counters to be shared across a horizontally-scaled Caddy cluster
+	// via any certmagic.Storage backend (file_system, redis, consul, s3,
+	// etc).
+	StorageRaw json.RawMessage `json:"storage,omitempty" caddy:"namespace=caddy.storage inline_key=module"`
+
+	// Storage is the resolved storage backend, populated in Provision
+	// from StorageRaw or, if unset, Caddy's configured default storage.
+	// It may be set directly by callers (e.g. tests) before Provision
+	// runs to bypass StorageRaw/Caddyfile loading entirely.
+	Storage certmagic.Storage `json:"-"`
+
+	// Unique enables unique-visitor mode: a repeat visit from the same
+	// visitor within UniqueWindow doesn't bump the counter.
+	Unique bool `json:"unique,omitempty"`
+
+	// UniqueWindow is how long a visitor is remembered once seen.
+	// Defaults to 24h.
+	UniqueWindow caddy.Duration `json:"unique_window,omitempty"`
+
+	// UniqueKey selects how a visitor's fingerprint is derived: "ip",
+	// "ip_ua" (IP + User-Agent), or "cookie:<name>". Defaults to "ip".
+	UniqueKey string `json:"unique_key,omitempty"`
+
+	// Metrics enables Prometheus metrics for this counter, scraped via
+	// Caddy's existing /metrics admin endpoint.
+	Metrics bool `json:"metrics,omitempty"`
+
+	// BucketMode selects which time-bucket granularities to retain for
+	// hitCounterToday/hitCounterWeek: "hourly", "daily", or "both".
+	// Defaults to "both".
+	BucketMode string `json:"buckets,omitempty"`
+
+	// Retention overrides how far back time buckets are kept. Defaults
+	// to 168h (7 days) for hourly buckets and 8760h (365 days) for
+	// daily buckets.
+	Retention caddy.Duration `json:"retention,omitempty"`
+
+	counters   map[string]uint64
+	updated    map[string]time.Time
+	dedup      map[string]*uniqueFilterPair
+	buckets    map[string]*bucketSet
+	countersMu sync.Mutex
+
+	// syncedCounters and syncedBuckets record this node's counters/buckets
+	// as of its last successful sync with shared storage. sync compares
+	// hc.counters/hc.buckets against these to compute this node's delta
+	// since then, so a horizontally-scaled cluster sharing one storage
+	// backend merges concurrent writers instead of one node's periodic
+	// flush silently overwriting another's. Guarded by countersMu.
+	syncedCounters map[string]uint64
+	syncedBuckets  map[string]*persistedBucket
+
+	// persistMu serializes the load-merge-store round trip in sync, so two
+	// concurrent increments on this node don't compute overlapping deltas
+	// against the same stale baseline.
+	persistMu sync.Mutex
+
+	metrics *hitCounterMetrics
+
+	ctx    context.Context
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (*HitCounter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "hitcounter",
+		New: func() caddy.Module { return new(HitCounter) },
+	}
+}
+
+// Provision sets up the hit counter, loading any counts persisted from a
+// previous run.
+func (hc *HitCounter) Provision(ctx caddy.Context) error {
+	hc.logger = ctx.Logger()
+	hc.ctx = ctx
+	hc.counters = make(map[string]uint64)
+	hc.updated = make(map[string]time.Time)
+	hc.buckets = make(map[string]*bucketSet)
+
+	if hc.KeyPrefix == "" {
+		hc.KeyPrefix = defaultKeyPrefix
+	}
+	if hc.BucketMode == "" {
+		hc.BucketMode = "both"
+	}
+
+	if hc.Storage == nil {
+		if hc.StorageRaw != nil {
+			val, err := ctx.LoadModule(hc, "StorageRaw")
+			if err != nil {
+				return fmt.Errorf("loading storage module: %v", err)
+			}
+			cmStorage, err := val.(caddy.StorageConverter).CertMagicStorage()
+			if err != nil {
+				return fmt.Errorf("creating storage configuration: %v", err)
+			}
+			hc.Storage = cmStorage
+		} else {
+			hc.Storage = ctx.Storage()
+		}
+	}
+
+	state, err := hc.loadPersistedState(hc.countersKey())
+	if err != nil {
+		return err
+	}
+	if state.Counters != nil {
+		hc.counters = state.Counters
+	}
+	for key, pb := range state.Buckets {
+		bs := newBucketSet()
+		if pb.Hourly != nil {
+			bs.hourly = pb.Hourly
+		}
+		if pb.Daily != nil {
+			bs.daily = pb.Daily
+		}
+		hc.buckets[key] = bs
+	}
+
+	// Seed the synced baselines to what was just loaded, so the first
+	// sync call computes a delta of zero for anything this node hasn't
+	// touched yet, rather than re-adding the whole loaded state on top of
+	// itself.
+	hc.syncedCounters = make(map[string]uint64, len(hc.counters))
+	for k, v := range hc.counters {
+		hc.syncedCounters[k] = v
+	}
+	hc.syncedBuckets = make(map[string]*persistedBucket, len(hc.buckets))
+	for key, bs := range hc.buckets {
+		hc.syncedBuckets[key] = &persistedBucket{
+			Hourly: copyInt64Uint64Map(bs.hourly),
+			Daily:  copyInt64Uint64Map(bs.daily),
+		}
+	}
+
+	if hc.Unique {
+		if hc.UniqueWindow <= 0 {
+			hc.UniqueWindow = caddy.Duration(defaultUniqueWindow)
+		}
+		if hc.UniqueKey == "" {
+			hc.UniqueKey = "ip"
+		}
+		hc.dedup = make(map[string]*uniqueFilterPair)
+		go hc.rotateUniqueFilters(ctx)
+	}
+
+	if hc.Metrics {
+		hc.metrics = newHitCounterMetrics()
+		if err := hc.metrics.register(prometheus.DefaultRegisterer); err != nil {
+			return fmt.Errorf("registering prometheus metrics: %v", err)
+		}
+	}
+
+	go hc.advanceBuckets(ctx)
+
+	setActiveHitCounter(hc)
+	return nil
+}
+
+// Cleanup implements caddy.CleanerUpper.
+func (hc *HitCounter) Cleanup() error {
+	// On a config reload the new instance is provisioned before the old
+	// one is cleaned up, so only clear the active app if it's still hc.
+	activeHitCounter.Lock()
+	if activeHitCounter.hc == hc {
+		activeHitCounter.hc = nil
+	}
+	activeHitCounter.Unlock()
+	if hc.metrics != nil {
+		hc.metrics.unregister(prometheus.DefaultRegisterer)
+	}
+	return nil
+}
+
+// countersKey returns the storage key the full counters map is persisted
+// under.
+func (hc *HitCounter) countersKey() string {
+	return hc.KeyPrefix + "counters.json"
+}
+
+// Start implements caddy.App. The counter does all its work on demand from
+// the template function, so there's nothing to start.
+func (hc *HitCounter) Start() error { return nil }
+
+// Stop implements caddy.App.
+func (hc *HitCounter) Stop() error { return nil }
+
+// CustomTemplateFunctions implements the templates module's interface for
+// registering custom template functions.
+func (hc *HitCounter) CustomTemplateFunctions() template.FuncMap {
+	return template.FuncMap{
+		"hitCounter":       hc.hitCounter,
+		"hitCounterUnique": hc.hitCounterUnique,
+		"hitCounterToday":  hc.hitCounterToday,
+		"hitCounterWeek":   hc.hitCounterWeek,
+		"hitCounterTop":    hc.hitCounterTop,
+		"hitCounterTotal":  hc.hitCounterTotal,
+	}
+}
+
+// hitCounter increments the counter for key and renders it as a row of
+// digit images in the configured style.
+func (hc *HitCounter) hitCounter(key string) (string, error) {
+	start := time.Now()
+	count, err := hc.increment(key)
+	if err != nil {
+		return "", err
+	}
+	result := hc.render(count)
+	hc.observeRender(start)
+	return result, nil
+}
+
+// increment bumps the counter for key by one, seeding it with InitialSeed
+// the first time the key is seen, and merges the result into shared
+// storage.
+func (hc *HitCounter) increment(key string) (uint64, error) {
+	hc.countersMu.Lock()
+	if _, ok := hc.counters[key]; !ok {
+		hc.counters[key] = hc.InitialSeed
+	}
+	hc.counters[key]++
+	count := hc.counters[key]
+	hc.markUpdatedLocked(key)
+	hc.setGaugeLocked(key, count)
+	hc.recordBucketLocked(key, time.Now())
+	counterDelta, bucketDelta := hc.keyDeltaLocked(key)
+	hc.countersMu.Unlock()
+
+	err := hc.sync([]string{key}, func(stored *persistedState) {
+		mergeCounterDelta(stored, key, counterDelta)
+		mergeBucketDelta(stored, key, bucketDelta)
+	})
+	if err != nil {
+		hc.recordPersistenceError()
+		hc.logger.Error("persisting hit counters", zap.Error(err))
+		return 0, err
+	}
+	return count, nil
+}
+
+// markUpdatedLocked records that key's counter changed just now. The
+// caller must hold countersMu.
+func (hc *HitCounter) markUpdatedLocked(key string) {
+	hc.updated[key] = time.Now()
+}
+
+// keyDeltaLocked returns how much key's counter and bucket slots have
+// grown since hc.syncedCounters/hc.syncedBuckets were last updated, i.e.
+// what this node has added locally since its last successful sync. The
+// caller must hold countersMu.
+func (hc *HitCounter) keyDeltaLocked(key string) (counterDelta uint64, bucketDelta *persistedBucket) {
+	if v := hc.counters[key]; v > hc.syncedCounters[key] {
+		counterDelta = v - hc.syncedCounters[key]
+	}
+
+	bs, ok := hc.buckets[key]
+	if !ok {
+		return counterDelta, nil
+	}
+	synced := hc.syncedBuckets[key]
+	var hourly, daily map[int64]uint64
+	for slot, v := range bs.hourly {
+		var s uint64
+		if synced != nil {
+			s = synced.Hourly[slot]
+		}
+		if v > s {
+			if hourly == nil {
+				hourly = make(map[int64]uint64)
+			}
+			hourly[slot] = v - s
+		}
+	}
+	for slot, v := range bs.daily {
+		var s uint64
+		if synced != nil {
+			s = synced.Daily[slot]
+		}
+		if v > s {
+			if daily == nil {
+				daily = make(map[int64]uint64)
+			}
+			daily[slot] = v - s
+		}
+	}
+	if hourly != nil || daily != nil {
+		bucketDelta = &persistedBucket{Hourly: hourly, Daily: daily}
+	}
+	return counterDelta, bucketDelta
+}
+
+// mergeCounterDelta adds delta to stored's counter for key, preserving
+// whatever other nodes have already written for it.
+func mergeCounterDelta(stored *persistedState, key string, delta uint64) {
+	if delta == 0 {
+		return
+	}
+	if stored.Counters == nil {
+		stored.Counters = make(map[string]uint64)
+	}
+	stored.Counters[key] += delta
+}
+
+// mergeBucketDelta adds delta's per-slot counts onto stored's bucket
+// history for key, preserving slots other nodes have already written.
+func mergeBucketDelta(stored *persistedState, key string, delta *persistedBucket) {
+	if delta == nil {
+		return
+	}
+	if stored.Buckets == nil {
+		stored.Buckets = make(map[string]*persistedBucket)
+	}
+	pb, ok := stored.Buckets[key]
+	if !ok {
+		pb = &persistedBucket{}
+		stored.Buckets[key] = pb
+	}
+	if len(delta.Hourly) > 0 {
+		if pb.Hourly == nil {
+			pb.Hourly = make(map[int64]uint64, len(delta.Hourly))
+		}
+		for slot, v := range delta.Hourly {
+			pb.Hourly[slot] += v
+		}
+	}
+	if len(delta.Daily) > 0 {
+		if pb.Daily == nil {
+			pb.Daily = make(map[int64]uint64, len(delta.Daily))
+		}
+		for slot, v := range delta.Daily {
+			pb.Daily[slot] += v
+		}
+	}
+}
+
+func copyInt64Uint64Map(m map[int64]uint64) map[int64]uint64 {
+	cp := make(map[int64]uint64, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// loadPersistedState reads and parses the counters/buckets blob from
+// storage, returning an empty, non-nil persistedState if nothing has been
+// persisted under key yet.
+func (hc *HitCounter) loadPersistedState(key string) (*persistedState, error) {
+	data, err := hc.Storage.Load(hc.ctx, key)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("loading persisted counters: %v", err)
+	}
+	state := &persistedState{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("parsing persisted counters: %v", err)
+		}
+	}
+	return state, nil
+}
+
+// sync merges touched keys into shared storage under a storage lock: it
+// loads the current persisted state, runs mutate (which should only touch
+// entries for keys in touched, either merging this node's delta on top of
+// the stored value or overwriting it for an explicit single-key admin
+// action), stores the result, then adopts the merged values for touched
+// keys back into hc.counters/hc.buckets so this node's view of them
+// matches the cluster-wide total.
+//
+// Only the touched keys are adopted, not the whole loaded state: a
+// concurrent increment for a different key may have already updated
+// hc.counters in memory while waiting on persistMu below, and adopting
+// keys this call never merged would clobber that not-yet-synced write.
+func (hc *HitCounter) sync(touched []string, mutate func(stored *persistedState)) error {
+	hc.persistMu.Lock()
+	defer hc.persistMu.Unlock()
+
+	key := hc.countersKey()
+	if err := hc.Storage.Lock(hc.ctx, key); err != nil {
+		return fmt.Errorf("locking counters: %v", err)
+	}
+	defer hc.Storage.Unlock(hc.ctx, key)
+
+	stored, err := hc.loadPersistedState(key)
+	if err != nil {
+		return err
+	}
+
+	mutate(stored)
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("marshaling counters: %v", err)
+	}
+	if err := hc.Storage.Store(hc.ctx, key, data); err != nil {
+		return fmt.Errorf("persisting counters: %v", err)
+	}
+
+	hc.countersMu.Lock()
+	hc.adoptLocked(touched, stored)
+	hc.countersMu.Unlock()
+	return nil
+}
+
+// adoptLocked copies touched keys from stored (the state that was just
+// merged into shared storage) into hc.counters/hc.buckets, and updates
+// hc.syncedCounters/hc.syncedBuckets to match so the next keyDeltaLocked
+// call for these keys starts from zero. The caller must hold countersMu.
+func (hc *HitCounter) adoptLocked(touched []string, stored *persistedState) {
+	for _, key := range touched {
+		if v, ok := stored.Counters[key]; ok {
+			hc.counters[key] = v
+			hc.syncedCounters[key] = v
+		} else {
+			delete(hc.counters, key)
+			delete(hc.syncedCounters, key)
+		}
+
+		if pb, ok := stored.Buckets[key]; ok {
+			bs := newBucketSet()
+			if pb.Hourly != nil {
+				bs.hourly = copyInt64Uint64Map(pb.Hourly)
+			}
+			if pb.Daily != nil {
+				bs.daily = copyInt64Uint64Map(pb.Daily)
+			}
+			hc.buckets[key] = bs
+			hc.syncedBuckets[key] = &persistedBucket{
+				Hourly: copyInt64Uint64Map(bs.hourly),
+				Daily:  copyInt64Uint64Map(bs.daily),
+			}
+		} else {
+			delete(hc.buckets, key)
+			delete(hc.syncedBuckets, key)
+		}
+	}
+}
+
+// render turns count into a row of digit images, e.g.
+// `<img src="/hitcounter/green/0.gif" alt="0">...`.
+func (hc *HitCounter) render(count uint64) string {
+	style := hc.Style
+	if style == "" {
+		style = defaultStyle
+	}
+
+	digits := strconv.FormatUint(count, 10)
+	if hc.PadDigits > len(digits) {
+		digits = strings.Repeat("0", hc.PadDigits-len(digits)) + digits
+	}
+
+	var b strings.Builder
+	b.WriteString(`<span class="hit-counter" title="Hit counter">`)
+	for _, d := range digits {
+		fmt.Fprintf(&b, `<img src="/hitcounter/%s/%c.gif" alt="%c">`, style, d, d)
+	}
+	b.WriteString(`</span>`)
+	return b.String()
+}
+
+// Interface guards.
+var (
+	_ caddy.Module       = (*HitCounter)(nil)
+	_ caddy.Provisioner  = (*HitCounter)(nil)
+	_ caddy.App          = (*HitCounter)(nil)
+	_ caddy.CleanerUpper = (*HitCounter)(nil)
+)
@@ -2,20 +2,18 @@ package hitcounter
 
 import (
 	"context"
-	"path/filepath"
 	"strings"
 	"testing"
 	"text/template"
 
 	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
 )
 
 func TestHitCounter_InitialSeed(t *testing.T) {
-	// Set up a temporary persistence path for this test
+	// Use a temporary file-backed storage for this test
 	tempDir := t.TempDir()
-	originalPath := persistencePath
-	persistencePath = filepath.Join(tempDir, "test_hitcounters.json")
-	defer func() { persistencePath = originalPath }()
+	storage := &certmagic.FileStorage{Path: tempDir}
 
 	tests := []struct {
 		name        string
@@ -54,6 +52,7 @@ func TestHitCounter_InitialSeed(t *testing.T) {
 			hc := &HitCounter{
 				InitialSeed: tt.initialSeed,
 				Style:       "green",
+				Storage:     storage,
 			}
 
 			// Create a test context with logger
@@ -93,15 +92,14 @@ func TestHitCounter_InitialSeed(t *testing.T) {
 }
 
 func TestHitCounter_MultipleIncrements(t *testing.T) {
-	// Set up a temporary persistence path for this test
+	// Use a temporary file-backed storage for this test
 	tempDir := t.TempDir()
-	originalPath := persistencePath
-	persistencePath = filepath.Join(tempDir, "test_hitcounters.json")
-	defer func() { persistencePath = originalPath }()
+	storage := &certmagic.FileStorage{Path: tempDir}
 
 	hc := &HitCounter{
 		InitialSeed: 50,
 		Style:       "green",
+		Storage:     storage,
 	}
 
 	// Create a test context with logger
@@ -160,16 +158,15 @@ func TestHitCounter_MultipleIncrements(t *testing.T) {
 }
 
 func TestHitCounter_PaddingWithSeed(t *testing.T) {
-	// Set up a temporary persistence path for this test
+	// Use a temporary file-backed storage for this test
 	tempDir := t.TempDir()
-	originalPath := persistencePath
-	persistencePath = filepath.Join(tempDir, "test_hitcounters.json")
-	defer func() { persistencePath = originalPath }()
+	storage := &certmagic.FileStorage{Path: tempDir}
 
 	hc := &HitCounter{
 		InitialSeed: 98,
 		PadDigits:   4,
 		Style:       "green",
+		Storage:     storage,
 	}
 
 	// Create a test context with logger
@@ -205,15 +202,14 @@ func TestHitCounter_PaddingWithSeed(t *testing.T) {
 }
 
 func TestHitCounter_TemplateFunctionIntegration(t *testing.T) {
-	// Set up a temporary persistence path for this test
+	// Use a temporary file-backed storage for this test
 	tempDir := t.TempDir()
-	originalPath := persistencePath
-	persistencePath = filepath.Join(tempDir, "test_hitcounters.json")
-	defer func() { persistencePath = originalPath }()
+	storage := &certmagic.FileStorage{Path: tempDir}
 
 	hc := &HitCounter{
 		InitialSeed: 500,
 		Style:       "green",
+		Storage:     storage,
 	}
 
 	// Create a test context with logger
@@ -252,6 +248,47 @@ func TestHitCounter_TemplateFunctionIntegration(t *testing.T) {
 	}
 }
 
+func TestHitCounter_SharedStorageMerge(t *testing.T) {
+	// Two HitCounter instances (simulating two nodes in a cluster) share
+	// one storage backend. Each records two hits on the same key; a third,
+	// freshly-provisioned node reading the persisted state afterward
+	// should see all four hits, not just whichever node persisted last.
+	tempDir := t.TempDir()
+	storage := &certmagic.FileStorage{Path: tempDir}
+
+	newNode := func() *HitCounter {
+		hc := &HitCounter{Style: "green", Storage: storage}
+		ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+		t.Cleanup(cancel)
+		if err := hc.Provision(ctx); err != nil {
+			t.Fatalf("Provision failed: %v", err)
+		}
+		return hc
+	}
+
+	nodeA := newNode()
+	nodeB := newNode()
+
+	for i := 0; i < 2; i++ {
+		if _, err := nodeA.hitCounter("shared"); err != nil {
+			t.Fatalf("nodeA hitCounter failed: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := nodeB.hitCounter("shared"); err != nil {
+			t.Fatalf("nodeB hitCounter failed: %v", err)
+		}
+	}
+
+	nodeC := newNode()
+	nodeC.countersMu.Lock()
+	count := nodeC.counters["shared"]
+	nodeC.countersMu.Unlock()
+	if count != 4 {
+		t.Errorf("count read back by a fresh node = %d, want 4", count)
+	}
+}
+
 func testContext(t *testing.T) caddy.Context {
 	t.Helper()
 	ctx, _ := caddy.NewContext(caddy.Context{Context: context.Background()})
@@ -0,0 +1,261 @@
+package hitcounter
+
+import (
+	"sort"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// defaultHourlyWindow and defaultDailyWindow bound how many slots each
+// bucket ring keeps when Retention isn't set: roughly the past week at
+// hourly granularity, and the past year at daily granularity.
+const (
+	defaultHourlyWindow = 168 // 7 days * 24 hours
+	defaultDailyWindow  = 365
+)
+
+// bucketAdvanceInterval is how often the background goroutine prunes
+// expired buckets and persists the result.
+const bucketAdvanceInterval = time.Hour
+
+// bucketSet is the hourly and daily hit-count rings for one counter key.
+// Slots are keyed by Unix time divided by the bucket's granularity, so
+// old entries can be pruned by comparing against a cutoff slot.
+type bucketSet struct {
+	hourly map[int64]uint64
+	daily  map[int64]uint64
+}
+
+func newBucketSet() *bucketSet {
+	return &bucketSet{
+		hourly: make(map[int64]uint64),
+		daily:  make(map[int64]uint64),
+	}
+}
+
+func hourSlot(t time.Time) int64 { return t.Unix() / int64(time.Hour/time.Second) }
+func daySlot(t time.Time) int64  { return t.Unix() / int64(24*time.Hour/time.Second) }
+
+// trackHourly and trackDaily report which granularities BucketMode asks
+// this counter to retain. The zero value behaves like "both".
+func (hc *HitCounter) trackHourly() bool {
+	return hc.BucketMode == "" || hc.BucketMode == "both" || hc.BucketMode == "hourly"
+}
+
+func (hc *HitCounter) trackDaily() bool {
+	return hc.BucketMode == "" || hc.BucketMode == "both" || hc.BucketMode == "daily"
+}
+
+func (hc *HitCounter) hourlyWindow() int {
+	if hc.Retention > 0 {
+		if h := int(time.Duration(hc.Retention) / time.Hour); h > 0 {
+			return h
+		}
+		return 1
+	}
+	return defaultHourlyWindow
+}
+
+func (hc *HitCounter) dailyWindow() int {
+	if hc.Retention > 0 {
+		if d := int(time.Duration(hc.Retention) / (24 * time.Hour)); d > 0 {
+			return d
+		}
+		return 1
+	}
+	return defaultDailyWindow
+}
+
+// recordBucketLocked records one hit for key at time t. The caller must
+// hold countersMu.
+func (hc *HitCounter) recordBucketLocked(key string, t time.Time) {
+	bs, ok := hc.buckets[key]
+	if !ok {
+		bs = newBucketSet()
+		hc.buckets[key] = bs
+	}
+	if hc.trackHourly() {
+		bs.hourly[hourSlot(t)]++
+	}
+	if hc.trackDaily() {
+		bs.daily[daySlot(t)]++
+	}
+}
+
+// pruneBucketsLocked discards slots older than the configured retention
+// window, relative to now. The caller must hold countersMu.
+func (hc *HitCounter) pruneBucketsLocked(now time.Time) {
+	hourCutoff := hourSlot(now) - int64(hc.hourlyWindow()) + 1
+	dayCutoff := daySlot(now) - int64(hc.dailyWindow()) + 1
+	for _, bs := range hc.buckets {
+		for slot := range bs.hourly {
+			if slot < hourCutoff {
+				delete(bs.hourly, slot)
+			}
+		}
+		for slot := range bs.daily {
+			if slot < dayCutoff {
+				delete(bs.daily, slot)
+			}
+		}
+	}
+}
+
+// advanceBuckets periodically prunes expired buckets and persists the
+// result, until ctx is done. It runs as a background goroutine started
+// from Provision.
+func (hc *HitCounter) advanceBuckets(ctx caddy.Context) {
+	ticker := time.NewTicker(bucketAdvanceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			hc.countersMu.Lock()
+			hc.pruneBucketsLocked(now)
+			keys := make([]string, 0, len(hc.buckets))
+			for key := range hc.buckets {
+				keys = append(keys, key)
+			}
+			hc.countersMu.Unlock()
+
+			for _, key := range keys {
+				if err := hc.syncPrunedBucket(key); err != nil {
+					hc.recordPersistenceError()
+					hc.logger.Error("persisting hit counter buckets", zap.String("key", key), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// syncPrunedBucket overwrites key's persisted bucket history with this
+// node's pruned view. Unlike increment's delta merge, pruning forgets
+// slots outright rather than adding to them, so like an admin reset it
+// force-overwrites key's entry instead of merging it.
+func (hc *HitCounter) syncPrunedBucket(key string) error {
+	hc.countersMu.Lock()
+	bs, ok := hc.buckets[key]
+	var pb *persistedBucket
+	if ok {
+		pb = &persistedBucket{Hourly: copyInt64Uint64Map(bs.hourly), Daily: copyInt64Uint64Map(bs.daily)}
+	}
+	hc.countersMu.Unlock()
+
+	return hc.sync([]string{key}, func(stored *persistedState) {
+		if pb == nil {
+			delete(stored.Buckets, key)
+			return
+		}
+		if stored.Buckets == nil {
+			stored.Buckets = make(map[string]*persistedBucket)
+		}
+		stored.Buckets[key] = pb
+	})
+}
+
+// hitCounterToday returns key's hit count for the current UTC calendar
+// day, from the hourly bucket ring.
+func (hc *HitCounter) hitCounterToday(key string) (uint64, error) {
+	hc.countersMu.Lock()
+	defer hc.countersMu.Unlock()
+
+	bs, ok := hc.buckets[key]
+	if !ok {
+		return 0, nil
+	}
+	today := daySlot(time.Now())
+	var total uint64
+	for hour, count := range bs.hourly {
+		if hour/24 == today {
+			total += count
+		}
+	}
+	return total, nil
+}
+
+// hitCounterWeek returns key's hit count for the trailing 7 days, from
+// the daily bucket ring (or the hourly ring, if daily buckets aren't
+// tracked).
+func (hc *HitCounter) hitCounterWeek(key string) (uint64, error) {
+	hc.countersMu.Lock()
+	defer hc.countersMu.Unlock()
+
+	bs, ok := hc.buckets[key]
+	if !ok {
+		return 0, nil
+	}
+
+	var total uint64
+	cutoff := daySlot(time.Now()) - 6
+	if hc.trackDaily() {
+		for day, count := range bs.daily {
+			if day >= cutoff {
+				total += count
+			}
+		}
+		return total, nil
+	}
+	for hour, count := range bs.hourly {
+		if hour/24 >= cutoff {
+			total += count
+		}
+	}
+	return total, nil
+}
+
+// TopEntry is one row of the hitCounterTop ranking.
+type TopEntry struct {
+	Key   string
+	Count uint64
+}
+
+// hitCounterTop returns the n keys with the highest all-time count,
+// highest first.
+func (hc *HitCounter) hitCounterTop(n int) ([]TopEntry, error) {
+	hc.countersMu.Lock()
+	entries := make([]TopEntry, 0, len(hc.counters))
+	for key, count := range hc.counters {
+		entries = append(entries, TopEntry{Key: key, Count: count})
+	}
+	hc.countersMu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if n >= 0 && n < len(entries) {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+// hitCounterTotal returns the sum of all-time counts across every key.
+func (hc *HitCounter) hitCounterTotal() (uint64, error) {
+	hc.countersMu.Lock()
+	defer hc.countersMu.Unlock()
+
+	var total uint64
+	for _, count := range hc.counters {
+		total += count
+	}
+	return total, nil
+}
+
+// persistedState is the JSON shape counters and their time buckets are
+// stored in, under countersKey().
+type persistedState struct {
+	Counters map[string]uint64           `json:"counters"`
+	Buckets  map[string]*persistedBucket `json:"buckets,omitempty"`
+}
+
+// persistedBucket is the on-disk representation of a bucketSet.
+type persistedBucket struct {
+	Hourly map[int64]uint64 `json:"hourly,omitempty"`
+	Daily  map[int64]uint64 `json:"daily,omitempty"`
+}
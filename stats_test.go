@@ -0,0 +1,156 @@
+package hitcounter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+)
+
+func newTestStatsHitCounter(t *testing.T, bucketMode string, retention time.Duration) *HitCounter {
+	t.Helper()
+	hc := &HitCounter{
+		Style:      "green",
+		Storage:    &certmagic.FileStorage{Path: t.TempDir()},
+		BucketMode: bucketMode,
+		Retention:  caddy.Duration(retention),
+	}
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := hc.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	return hc
+}
+
+func TestHitCounter_RecordAndPruneBuckets(t *testing.T) {
+	hc := newTestStatsHitCounter(t, "both", 2*time.Hour)
+
+	now := time.Now()
+	hc.countersMu.Lock()
+	hc.recordBucketLocked("a", now)
+	hc.recordBucketLocked("a", now.Add(-3*time.Hour)) // outside the 2h retention window
+	hc.countersMu.Unlock()
+
+	hc.countersMu.Lock()
+	hc.pruneBucketsLocked(now)
+	bs := hc.buckets["a"]
+	hourly := len(bs.hourly)
+	hc.countersMu.Unlock()
+
+	if hourly != 1 {
+		t.Errorf("hourly slots after pruning = %d, want 1", hourly)
+	}
+}
+
+func TestHitCounter_HitCounterToday(t *testing.T) {
+	hc := newTestStatsHitCounter(t, "both", 0)
+
+	now := time.Now()
+	hc.countersMu.Lock()
+	hc.recordBucketLocked("a", now)
+	hc.recordBucketLocked("a", now)
+	hc.recordBucketLocked("a", now.AddDate(0, 0, -1))
+	hc.countersMu.Unlock()
+
+	today, err := hc.hitCounterToday("a")
+	if err != nil {
+		t.Fatalf("hitCounterToday failed: %v", err)
+	}
+	if today != 2 {
+		t.Errorf("hitCounterToday = %d, want 2", today)
+	}
+}
+
+func TestHitCounter_HitCounterWeek(t *testing.T) {
+	hc := newTestStatsHitCounter(t, "both", 0)
+
+	now := time.Now()
+	hc.countersMu.Lock()
+	hc.recordBucketLocked("a", now)
+	hc.recordBucketLocked("a", now.AddDate(0, 0, -3))
+	hc.recordBucketLocked("a", now.AddDate(0, 0, -10)) // outside the trailing 7 days
+	hc.countersMu.Unlock()
+
+	week, err := hc.hitCounterWeek("a")
+	if err != nil {
+		t.Fatalf("hitCounterWeek failed: %v", err)
+	}
+	if week != 2 {
+		t.Errorf("hitCounterWeek = %d, want 2", week)
+	}
+}
+
+func TestHitCounter_HitCounterTop(t *testing.T) {
+	hc := newTestStatsHitCounter(t, "both", 0)
+
+	for i := 0; i < 5; i++ {
+		if _, err := hc.hitCounter("popular"); err != nil {
+			t.Fatalf("hitCounter failed: %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := hc.hitCounter("less-popular"); err != nil {
+			t.Fatalf("hitCounter failed: %v", err)
+		}
+	}
+	if _, err := hc.hitCounter("least-popular"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+
+	top, err := hc.hitCounterTop(2)
+	if err != nil {
+		t.Fatalf("hitCounterTop failed: %v", err)
+	}
+	if len(top) != 2 {
+		t.Fatalf("len(top) = %d, want 2", len(top))
+	}
+	if top[0].Key != "popular" || top[0].Count != 5 {
+		t.Errorf("top[0] = %+v, want {popular 5}", top[0])
+	}
+	if top[1].Key != "less-popular" || top[1].Count != 2 {
+		t.Errorf("top[1] = %+v, want {less-popular 2}", top[1])
+	}
+}
+
+func TestHitCounter_HitCounterTotal(t *testing.T) {
+	hc := newTestStatsHitCounter(t, "both", 0)
+
+	if _, err := hc.hitCounter("a"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+	if _, err := hc.hitCounter("b"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+	if _, err := hc.hitCounter("b"); err != nil {
+		t.Fatalf("hitCounter failed: %v", err)
+	}
+
+	total, err := hc.hitCounterTotal()
+	if err != nil {
+		t.Fatalf("hitCounterTotal failed: %v", err)
+	}
+	if total != 3 {
+		t.Errorf("hitCounterTotal = %d, want 3", total)
+	}
+}
+
+func TestHitCounter_BucketModeHourlyOnly(t *testing.T) {
+	hc := newTestStatsHitCounter(t, "hourly", 0)
+
+	now := time.Now()
+	hc.countersMu.Lock()
+	hc.recordBucketLocked("a", now)
+	bs := hc.buckets["a"]
+	hourly, daily := len(bs.hourly), len(bs.daily)
+	hc.countersMu.Unlock()
+
+	if hourly != 1 {
+		t.Errorf("hourly slots = %d, want 1", hourly)
+	}
+	if daily != 0 {
+		t.Errorf("daily slots = %d, want 0 (buckets hourly-only)", daily)
+	}
+}
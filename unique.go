@@ -0,0 +1,317 @@
+package hitcounter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/cespare/xxhash/v2"
+	"go.uber.org/zap"
+)
+
+// uniqueFilterCapacity is the expected number of distinct visitors per key
+// within a single unique_window, used to size each bloom filter for a
+// ~1% false-positive rate.
+const uniqueFilterCapacity = 100_000
+
+// uniqueFilterFPRate is the target false-positive rate for the bloom
+// filters backing unique-visitor deduplication.
+const uniqueFilterFPRate = 0.01
+
+// defaultUniqueWindow is how long a visitor is remembered when unique mode
+// is enabled but unique_window isn't set.
+const defaultUniqueWindow = 24 * time.Hour
+
+// uniqueFilterPair is a rotating pair of bloom filters used to deduplicate
+// visitors for one counter key without growing memory unboundedly. Writes
+// only ever go to active; both are consulted on read. Rotating active and
+// standby every unique_window means a fingerprint is remembered for at
+// least one full window and at most two.
+//
+// mu guards active/standby: concurrent requests for the same counter key
+// share a *uniqueFilterPair (handed out by dedupPair), and the periodic
+// rotation goroutine can swap the filters out from under them, so access
+// to the filters themselves needs its own lock independent of countersMu
+// (which only protects the hc.dedup map lookup).
+type uniqueFilterPair struct {
+	mu      sync.Mutex
+	active  *bloom.BloomFilter
+	standby *bloom.BloomFilter
+}
+
+func newUniqueFilterPair() *uniqueFilterPair {
+	return &uniqueFilterPair{
+		active:  bloom.NewWithEstimates(uniqueFilterCapacity, uniqueFilterFPRate),
+		standby: bloom.NewWithEstimates(uniqueFilterCapacity, uniqueFilterFPRate),
+	}
+}
+
+// testAndAdd reports whether fingerprint has already been seen in either
+// filter, adding it to the active filter if not. Testing and adding happen
+// under a single lock so two concurrent first-sightings of the same
+// fingerprint can't both observe "not seen".
+func (p *uniqueFilterPair) testAndAdd(fingerprint uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := fingerprintBytes(fingerprint)
+	if p.active.Test(b) || p.standby.Test(b) {
+		return true
+	}
+	p.active.Add(b)
+	return false
+}
+
+// rotate clears the standby filter and makes it the new active one,
+// demoting the old active filter to standby, so a fingerprint seen just
+// before rotation survives one more cycle before it can be forgotten.
+func (p *uniqueFilterPair) rotate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.standby.ClearAll()
+	p.active, p.standby = p.standby, p.active
+}
+
+// snapshot returns binary-encoded copies (via BloomFilter.WriteTo) of the
+// active and standby filters, suitable for persisting. Taking the
+// snapshot under p.mu keeps it
+// consistent with concurrent testAndAdd/rotate calls on the same pair.
+func (p *uniqueFilterPair) snapshot() (active, standby []byte, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var a, s bytes.Buffer
+	if _, err := p.active.WriteTo(&a); err != nil {
+		return nil, nil, fmt.Errorf("encoding active filter: %v", err)
+	}
+	if _, err := p.standby.WriteTo(&s); err != nil {
+		return nil, nil, fmt.Errorf("encoding standby filter: %v", err)
+	}
+	return a.Bytes(), s.Bytes(), nil
+}
+
+func fingerprintBytes(fingerprint uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, fingerprint)
+	return b
+}
+
+// persistedFilterPair is the on-disk representation of a uniqueFilterPair.
+type persistedFilterPair struct {
+	Active  []byte `json:"active"`
+	Standby []byte `json:"standby"`
+}
+
+// hitCounterUnique is like hitCounter, but only increments the count if
+// the visitor (identified per UniqueKey) hasn't been seen for this key
+// within the current unique_window.
+func (hc *HitCounter) hitCounterUnique(key string, r *http.Request) (string, error) {
+	if !hc.Unique {
+		return hc.hitCounter(key)
+	}
+
+	start := time.Now()
+
+	visitor, err := visitorFingerprint(r, hc.UniqueKey)
+	if err != nil {
+		return "", err
+	}
+	fingerprint := xxhash.Sum64String(key + "||" + visitor)
+
+	pair, err := hc.dedupPair(key)
+	if err != nil {
+		return "", err
+	}
+
+	if pair.testAndAdd(fingerprint) {
+		result := hc.render(hc.currentCount(key))
+		hc.observeRender(start)
+		return result, nil
+	}
+
+	if err := hc.persistUniqueFilterPair(key, pair); err != nil {
+		hc.logger.Error("persisting unique-visitor filters", zap.String("key", key), zap.Error(err))
+	}
+
+	return hc.hitCounter(key)
+}
+
+// currentCount returns the counter for key without incrementing it.
+func (hc *HitCounter) currentCount(key string) uint64 {
+	hc.countersMu.Lock()
+	defer hc.countersMu.Unlock()
+	return hc.counters[key]
+}
+
+// dedupPair returns the uniqueFilterPair for key, loading it from storage
+// on first use so restarts don't reset dedup state.
+func (hc *HitCounter) dedupPair(key string) (*uniqueFilterPair, error) {
+	hc.countersMu.Lock()
+	pair, ok := hc.dedup[key]
+	hc.countersMu.Unlock()
+	if ok {
+		return pair, nil
+	}
+
+	loaded, err := hc.loadUniqueFilterPair(key)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.countersMu.Lock()
+	defer hc.countersMu.Unlock()
+	if existing, ok := hc.dedup[key]; ok {
+		return existing, nil
+	}
+	hc.dedup[key] = loaded
+	return loaded, nil
+}
+
+func (hc *HitCounter) uniqueStorageKey(key string) string {
+	return hc.KeyPrefix + "unique/" + key + ".json"
+}
+
+func (hc *HitCounter) loadUniqueFilterPair(key string) (*uniqueFilterPair, error) {
+	data, err := hc.Storage.Load(hc.ctx, hc.uniqueStorageKey(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return newUniqueFilterPair(), nil
+		}
+		return nil, fmt.Errorf("loading unique-visitor filters for %q: %v", key, err)
+	}
+
+	var persisted persistedFilterPair
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return nil, fmt.Errorf("parsing unique-visitor filters for %q: %v", key, err)
+	}
+
+	pair := newUniqueFilterPair()
+	if len(persisted.Active) > 0 {
+		if _, err := pair.active.ReadFrom(bytes.NewReader(persisted.Active)); err != nil {
+			return nil, fmt.Errorf("decoding active filter for %q: %v", key, err)
+		}
+	}
+	if len(persisted.Standby) > 0 {
+		if _, err := pair.standby.ReadFrom(bytes.NewReader(persisted.Standby)); err != nil {
+			return nil, fmt.Errorf("decoding standby filter for %q: %v", key, err)
+		}
+	}
+	return pair, nil
+}
+
+// clearUniqueFilter drops key's in-memory unique-visitor filter pair and
+// deletes its persisted blob, so an admin reset or delete doesn't leave a
+// stale bloom filter suppressing hits from visitors it already saw.
+func (hc *HitCounter) clearUniqueFilter(key string) error {
+	hc.countersMu.Lock()
+	delete(hc.dedup, key)
+	hc.countersMu.Unlock()
+
+	if err := hc.Storage.Delete(hc.ctx, hc.uniqueStorageKey(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting unique-visitor filters for %q: %v", key, err)
+	}
+	return nil
+}
+
+func (hc *HitCounter) persistUniqueFilterPair(key string, pair *uniqueFilterPair) error {
+	active, standby, err := pair.snapshot()
+	if err != nil {
+		return fmt.Errorf("encoding unique-visitor filters for %q: %v", key, err)
+	}
+
+	data, err := json.Marshal(persistedFilterPair{Active: active, Standby: standby})
+	if err != nil {
+		return fmt.Errorf("marshaling unique-visitor filters for %q: %v", key, err)
+	}
+	if err := hc.Storage.Store(hc.ctx, hc.uniqueStorageKey(key), data); err != nil {
+		return fmt.Errorf("persisting unique-visitor filters for %q: %v", key, err)
+	}
+	return nil
+}
+
+// rotateUniqueFilters periodically rotates every key's filter pair until
+// ctx is done. It runs as a background goroutine started from Provision
+// when Unique is enabled.
+func (hc *HitCounter) rotateUniqueFilters(ctx caddy.Context) {
+	interval := time.Duration(hc.UniqueWindow)
+	if interval <= 0 {
+		interval = defaultUniqueWindow
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hc.rotateAllUniqueFilters()
+		}
+	}
+}
+
+func (hc *HitCounter) rotateAllUniqueFilters() {
+	hc.countersMu.Lock()
+	pairs := make(map[string]*uniqueFilterPair, len(hc.dedup))
+	for key, pair := range hc.dedup {
+		pairs[key] = pair
+	}
+	hc.countersMu.Unlock()
+
+	// Rotate and persist outside of countersMu: each pair has its own lock
+	// (see uniqueFilterPair.rotate), so concurrent testAndAdd calls on
+	// other keys aren't blocked by one key's rotation or storage write.
+	for key, pair := range pairs {
+		pair.rotate()
+		if err := hc.persistUniqueFilterPair(key, pair); err != nil {
+			hc.logger.Error("persisting rotated unique-visitor filters", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// visitorFingerprint derives a visitor identifier from r according to
+// uniqueKey, which is one of "ip", "ip_ua", or "cookie:<name>".
+//
+// A missing cookie isn't a hard error: nothing in this module issues the
+// cookie itself, so every visitor is missing it until some other part of
+// the site sets one. Falling back to the IP means those visitors are
+// still deduplicated (just less precisely) instead of failing the page
+// render outright.
+func visitorFingerprint(r *http.Request, uniqueKey string) (string, error) {
+	switch {
+	case uniqueKey == "" || uniqueKey == "ip":
+		return clientIP(r), nil
+
+	case uniqueKey == "ip_ua":
+		return clientIP(r) + "|" + r.UserAgent(), nil
+
+	case strings.HasPrefix(uniqueKey, "cookie:"):
+		name := strings.TrimPrefix(uniqueKey, "cookie:")
+		c, err := r.Cookie(name)
+		if err != nil {
+			return clientIP(r), nil
+		}
+		return c.Value, nil
+
+	default:
+		return "", fmt.Errorf("unrecognized unique_key %q", uniqueKey)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
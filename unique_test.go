@@ -0,0 +1,158 @@
+package hitcounter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+)
+
+func newTestHitCounterUnique(t *testing.T) *HitCounter {
+	t.Helper()
+	hc := &HitCounter{
+		Style:   "green",
+		Storage: &certmagic.FileStorage{Path: t.TempDir()},
+		Unique:  true,
+	}
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := hc.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	return hc
+}
+
+func requestFromIP(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":12345"
+	return r
+}
+
+func TestHitCounter_UniqueDedup(t *testing.T) {
+	hc := newTestHitCounterUnique(t)
+
+	if _, err := hc.hitCounterUnique("page1", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+	if count := hc.currentCount("page1"); count != 1 {
+		t.Fatalf("count after first visit = %d, want 1", count)
+	}
+
+	// Same visitor again: shouldn't bump the counter.
+	if _, err := hc.hitCounterUnique("page1", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+	if count := hc.currentCount("page1"); count != 1 {
+		t.Fatalf("count after repeat visit = %d, want 1", count)
+	}
+
+	// A different visitor should still bump the counter.
+	if _, err := hc.hitCounterUnique("page1", requestFromIP("5.6.7.8")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+	if count := hc.currentCount("page1"); count != 2 {
+		t.Fatalf("count after second visitor = %d, want 2", count)
+	}
+
+	// A different key is tracked independently.
+	if _, err := hc.hitCounterUnique("page2", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed: %v", err)
+	}
+	if count := hc.currentCount("page2"); count != 1 {
+		t.Fatalf("count for page2 = %d, want 1", count)
+	}
+}
+
+func TestVisitorFingerprint_MissingCookieFallsBackToIP(t *testing.T) {
+	r := requestFromIP("1.2.3.4")
+
+	visitor, err := visitorFingerprint(r, "cookie:session")
+	if err != nil {
+		t.Fatalf("visitorFingerprint failed: %v", err)
+	}
+	if visitor != "1.2.3.4" {
+		t.Errorf("visitor = %q, want IP fallback %q", visitor, "1.2.3.4")
+	}
+}
+
+func TestHitCounter_UniqueCookieKeyWithoutCookieDoesNotError(t *testing.T) {
+	hc := &HitCounter{
+		Style:     "green",
+		Storage:   &certmagic.FileStorage{Path: t.TempDir()},
+		Unique:    true,
+		UniqueKey: "cookie:session",
+	}
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := hc.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+
+	if _, err := hc.hitCounterUnique("page1", requestFromIP("1.2.3.4")); err != nil {
+		t.Fatalf("hitCounterUnique failed for a request without the configured cookie: %v", err)
+	}
+	if count := hc.currentCount("page1"); count != 1 {
+		t.Fatalf("count = %d, want 1", count)
+	}
+}
+
+func TestUniqueFilterPair_Rotate(t *testing.T) {
+	pair := newUniqueFilterPair()
+	const fp = uint64(42)
+
+	if seen := pair.testAndAdd(fp); seen {
+		t.Fatal("fingerprint should not be seen before it's added")
+	}
+	if seen := pair.testAndAdd(fp); !seen {
+		t.Fatal("fingerprint should be seen once added")
+	}
+
+	// One rotation moves the fingerprint from active to standby; it's
+	// still remembered.
+	pair.rotate()
+	if seen := pair.testAndAdd(fp); !seen {
+		t.Fatal("fingerprint should still be seen one rotation later")
+	}
+
+	// A second rotation clears what's now the standby (the original
+	// active), forgetting the fingerprint.
+	pair.rotate()
+	if seen := pair.testAndAdd(fp); seen {
+		t.Fatal("fingerprint should be forgotten after two rotations")
+	}
+}
+
+// TestUniqueFilterPair_TestAndAddConcurrent exercises testAndAdd from many
+// goroutines at once; run with -race to confirm the filter pair's lock
+// actually serializes access to the underlying bloom filters.
+func TestUniqueFilterPair_TestAndAddConcurrent(t *testing.T) {
+	pair := newUniqueFilterPair()
+	const fp = uint64(7)
+	const goroutines = 50
+
+	results := make(chan bool, goroutines)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- pair.testAndAdd(fp)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var newCount int
+	for seen := range results {
+		if !seen {
+			newCount++
+		}
+	}
+	if newCount != 1 {
+		t.Errorf("exactly one concurrent call should observe the fingerprint as new, got %d", newCount)
+	}
+}